@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/chai2010/webp"
+	"golang.org/x/image/draw"
+)
+
+// CompressConfig 控制上传前的图片压缩/转码行为
+type CompressConfig struct {
+	Enabled      bool   `json:"enabled"`       // 是否开启压缩
+	Quality      int    `json:"quality"`       // 压缩质量 (1-100)，0 表示使用默认值
+	MaxDimension int    `json:"max_dimension"` // 长边最大像素，0 表示不缩放
+	TargetFormat string `json:"target_format"` // webp / mozjpeg / oxipng
+	SquooshPath  string `json:"squoosh_path"`  // squoosh-cli 可执行文件路径，留空则自动在 PATH 中查找
+}
+
+const defaultCompressQuality = 80
+
+// compressImage 压缩/转码图片数据，返回新的字节内容、新的文件扩展名 (不含 "."）
+// 未开启压缩或未知目标格式时原样返回
+func compressImage(data []byte, cfg CompressConfig) ([]byte, string, error) {
+	if !cfg.Enabled {
+		return data, DetectImageFormat(data), nil
+	}
+
+	if squooshBin := resolveSquooshPath(cfg.SquooshPath); squooshBin != "" {
+		out, ext, err := compressWithSquoosh(squooshBin, data, cfg)
+		if err != nil {
+			log.Printf("squoosh-cli 压缩失败，回退到纯 Go 压缩: %v", err)
+		} else {
+			return out, ext, nil
+		}
+	}
+
+	return compressWithGo(data, cfg)
+}
+
+// resolveSquooshPath 查找 squoosh-cli 可执行文件，未安装时返回空字符串
+func resolveSquooshPath(configured string) string {
+	if configured != "" {
+		if _, err := os.Stat(configured); err == nil {
+			return configured
+		}
+		return ""
+	}
+	path, err := exec.LookPath("squoosh-cli")
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// compressWithSquoosh 通过 shell 调用 squoosh-cli 完成压缩/转码
+func compressWithSquoosh(squooshBin string, data []byte, cfg CompressConfig) ([]byte, string, error) {
+	tmpDir, err := ioutil.TempDir("", "photoclassifier-squoosh-")
+	if err != nil {
+		return nil, "", fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	srcExt := DetectImageFormat(data)
+	srcPath := filepath.Join(tmpDir, "input."+srcExt)
+	if err := ioutil.WriteFile(srcPath, data, 0o644); err != nil {
+		return nil, "", fmt.Errorf("写入临时源文件失败: %w", err)
+	}
+
+	outDir := filepath.Join(tmpDir, "out")
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return nil, "", fmt.Errorf("创建输出目录失败: %w", err)
+	}
+
+	args := []string{"--output-dir", outDir}
+	switch cfg.TargetFormat {
+	case "webp":
+		args = append(args, "--webp", "auto")
+	case "mozjpeg":
+		args = append(args, "--mozjpeg", "auto")
+	case "oxipng":
+		args = append(args, "--oxipng", "auto")
+	default:
+		return nil, "", fmt.Errorf("squoosh-cli 不支持的目标格式: %s", cfg.TargetFormat)
+	}
+	if cfg.MaxDimension > 0 {
+		args = append(args, "--resize", fmt.Sprintf(`{"enabled":true,"width":%d,"height":%d}`, cfg.MaxDimension, cfg.MaxDimension))
+	}
+	args = append(args, srcPath)
+
+	cmd := exec.Command(squooshBin, args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, "", fmt.Errorf("执行 squoosh-cli 失败: %w, 输出: %s", err, string(out))
+	}
+
+	entries, err := ioutil.ReadDir(outDir)
+	if err != nil || len(entries) == 0 {
+		return nil, "", fmt.Errorf("squoosh-cli 未产生输出文件")
+	}
+
+	outPath := filepath.Join(outDir, entries[0].Name())
+	outData, err := ioutil.ReadFile(outPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("读取 squoosh-cli 输出失败: %w", err)
+	}
+
+	return outData, DetectImageFormat(outData), nil
+}
+
+// compressWithGo 使用纯 Go 实现完成缩放与转码 (webp/mozjpeg 回退为标准 jpeg 编码)
+func compressWithGo(data []byte, cfg CompressConfig) ([]byte, string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("解码图片失败: %w", err)
+	}
+
+	if cfg.MaxDimension > 0 {
+		img = resizeToMaxDimension(img, cfg.MaxDimension)
+	}
+
+	quality := cfg.Quality
+	if quality <= 0 {
+		quality = defaultCompressQuality
+	}
+
+	var buf bytes.Buffer
+	switch cfg.TargetFormat {
+	case "webp":
+		if err := webp.Encode(&buf, img, &webp.Options{Quality: float32(quality)}); err != nil {
+			return nil, "", fmt.Errorf("编码 webp 失败: %w", err)
+		}
+	case "mozjpeg", "jpeg", "jpg":
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, "", fmt.Errorf("编码 jpeg 失败: %w", err)
+		}
+	case "oxipng", "png":
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", fmt.Errorf("编码 png 失败: %w", err)
+		}
+	default:
+		return nil, "", fmt.Errorf("不支持的目标格式: %s", cfg.TargetFormat)
+	}
+
+	out := buf.Bytes()
+	return out, DetectImageFormat(out), nil
+}
+
+// resizeToMaxDimension 等比缩放图片，使长边不超过 maxDim
+func resizeToMaxDimension(img image.Image, maxDim int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= maxDim && h <= maxDim {
+		return img
+	}
+
+	var newW, newH int
+	if w >= h {
+		newW = maxDim
+		newH = h * maxDim / w
+	} else {
+		newH = maxDim
+		newW = w * maxDim / h
+	}
+	if newW < 1 {
+		newW = 1
+	}
+	if newH < 1 {
+		newH = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, newW, newH))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
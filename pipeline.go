@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultClassifyConcurrency = 4
+	defaultUploadConcurrency   = 4
+)
+
+// uploadJob 是分类阶段产出、交给上传阶段消费的一张图片
+type uploadJob struct {
+	name       string
+	data       []byte
+	ext        string
+	categories []string
+}
+
+// runPipeline 用分类、上传两级 worker pool 并发处理文件夹中的图片：
+// 分类阶段的 goroutine 从文件 channel 取任务、限速调用模型，产出写入上传 channel；
+// 上传阶段的 goroutine 从上传 channel 取任务、推送到 Uploader 后端。
+// 收到 SIGINT 时停止派发新任务、等待在途任务完成，并把 classMap 落盘，
+// 以便下次启动时 class_idx 能从断点续跑。
+func runPipeline(cfg Config, files []os.FileInfo, prompt string, classifier VisionClassifier, uploader Uploader) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT)
+	defer signal.Stop(sigCh)
+	go func() {
+		if _, ok := <-sigCh; ok {
+			log.Println("收到中断信号，停止派发新任务并等待在途任务完成...")
+			cancel()
+		}
+	}()
+
+	classifyConcurrency := cfg.ClassifyConcurrency
+	if classifyConcurrency <= 0 {
+		classifyConcurrency = defaultClassifyConcurrency
+	}
+	uploadConcurrency := cfg.UploadConcurrency
+	if uploadConcurrency <= 0 {
+		uploadConcurrency = defaultUploadConcurrency
+	}
+
+	var limiter *rate.Limiter
+	if cfg.ClassifyRPM > 0 {
+		limiter = rate.NewLimiter(rate.Limit(float64(cfg.ClassifyRPM)/60.0), 1)
+	}
+
+	var classMapMu sync.Mutex
+
+	fileCh := make(chan os.FileInfo)
+	uploadCh := make(chan uploadJob)
+
+	var classifyWg, uploadWg sync.WaitGroup
+
+	for i := 0; i < classifyConcurrency; i++ {
+		classifyWg.Add(1)
+		go func() {
+			defer classifyWg.Done()
+			classifyWorker(ctx, cfg, prompt, classifier, limiter, fileCh, uploadCh)
+		}()
+	}
+
+	for i := 0; i < uploadConcurrency; i++ {
+		uploadWg.Add(1)
+		go func() {
+			defer uploadWg.Done()
+			uploadWorker(ctx, cfg, uploader, &classMapMu, uploadCh)
+		}()
+	}
+
+	go func() {
+		defer close(fileCh)
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			if !isImageFile(file.Name()) {
+				log.Printf("跳过文件 %s: 不是图片文件\n", file.Name())
+				continue
+			}
+			select {
+			case fileCh <- file:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	classifyWg.Wait()
+	close(uploadCh)
+	uploadWg.Wait()
+
+	if err := persistClassMap(cfg); err != nil {
+		log.Printf("保存分类索引失败: %v", err)
+	}
+}
+
+// classifyWorker 从 fileCh 消费文件，限速调用 VisionClassifier 完成分类，产出写入 uploadCh
+func classifyWorker(ctx context.Context, cfg Config, prompt string, classifier VisionClassifier, limiter *rate.Limiter, fileCh <-chan os.FileInfo, uploadCh chan<- uploadJob) {
+	for file := range fileCh {
+		filePath := filepath.Join(cfg.ImageFolder, file.Name())
+
+		imgData, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			log.Printf("无法读取文件 %s: %v", filePath, err)
+			continue
+		}
+
+		if limiter != nil {
+			if err := limiter.Wait(ctx); err != nil {
+				return
+			}
+		}
+
+		var categories []string
+		var token int
+		err = withRetry(ctx, func() error {
+			var classifyErr error
+			categories, token, classifyErr = classifier.Classify(ctx, imgData, prompt)
+			return classifyErr
+		})
+		if err != nil {
+			log.Printf("分类图片 %s 失败: %v", file.Name(), err)
+			continue
+		}
+
+		fmt.Printf("图片 %s -> 模型返回的分类标签: %v, 使用token: %d\n", filePath, categories, token)
+
+		if len(categories) == 0 {
+			fmt.Printf("  -> 模型未返回有效分类标签，跳过上传。\n")
+			continue
+		}
+
+		uploadData, uploadExt, err := compressImage(imgData, cfg.Compress)
+		if err != nil {
+			log.Printf("压缩图片 %s 失败，回退为原始数据: %v", file.Name(), err)
+			uploadData, uploadExt = imgData, DetectImageFormat(imgData)
+		}
+
+		select {
+		case uploadCh <- uploadJob{name: file.Name(), data: uploadData, ext: uploadExt, categories: categories}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// uploadWorker 从 uploadCh 消费分类结果，逐个类别推送到 Uploader 后端
+func uploadWorker(ctx context.Context, cfg Config, uploader Uploader, classMapMu *sync.Mutex, uploadCh <-chan uploadJob) {
+	for job := range uploadCh {
+		for _, cat := range job.categories {
+			safeCat := sanitizeCategory(cat)
+
+			// 读取并预占索引必须在同一临界区内完成，否则两个 goroutine 可能
+			// 读到同一个 idx、拼出同一个文件名，导致第二次上传覆盖第一次
+			// (并把索引永久性地往后顶一位的失败也只是留下一个空洞，好过覆盖)。
+			classMapMu.Lock()
+			idx := classMap[cat]
+			classMap[cat]++
+			classMapMu.Unlock()
+
+			fname := strconv.Itoa(idx) + "." + job.ext
+			uploadPath := filepath.Join(cfg.GitHubDir, safeCat, fname)
+			commitMsg := fmt.Sprintf("[PhotoClassifier] Classify and upload %s to category %s", job.name, cat)
+
+			var publicURL string
+			err := withRetry(ctx, func() error {
+				var uploadErr error
+				publicURL, uploadErr = uploader.Upload(ctx, uploadPath, job.data, commitMsg)
+				return uploadErr
+			})
+			if err != nil {
+				log.Printf("  -> 上传图片 %s 到 %s 失败: %v", job.name, safeCat, err)
+				continue
+			}
+
+			fmt.Printf("  -> 上传成功: %s\n", publicURL)
+		}
+	}
+}
+
+// persistClassMap 把当前 classMap 按 TargetClasses 的顺序写回 conf.json 的 class_idx 字段，
+// 使下次启动时各类别计数能从断点续跑
+func persistClassMap(cfg Config) error {
+	classes := strings.Split(cfg.TargetClasses, ",")
+	idxParts := make([]string, len(classes))
+	for i, class := range classes {
+		idxParts[i] = strconv.Itoa(classMap[class])
+	}
+	cfg.ClassIdx = strings.Join(idxParts, ",")
+	config.ClassIdx = cfg.ClassIdx
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化配置失败: %w", err)
+	}
+	return ioutil.WriteFile("./conf.json", data, 0o644)
+}
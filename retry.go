@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	retryMaxAttempts = 5
+	retryBaseDelay   = 1 * time.Second
+	retryMaxDelay    = 30 * time.Second
+)
+
+// HTTPStatusError 包装 HTTP 响应状态码，供重试逻辑判断是否值得重试
+type HTTPStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("HTTP 状态码 %d: %s", e.StatusCode, e.Body)
+}
+
+// isRetryableErr 判断错误是否值得重试: 429/5xx 响应，或网络层错误 (超时、连接失败等)
+func isRetryableErr(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == 429 || statusErr.StatusCode >= 500
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// withRetry 对 fn 执行指数退避重试: 基础延迟 1s，每次翻倍，最大延迟 30s，最多尝试 5 次
+func withRetry(ctx context.Context, fn func() error) error {
+	delay := retryBaseDelay
+	var err error
+	for attempt := 1; attempt <= retryMaxAttempts; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+		if attempt == retryMaxAttempts || !isRetryableErr(err) {
+			return err
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		delay *= 2
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+	return err
+}
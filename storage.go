@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Uploader 抽象存储后端，负责把压缩后的图片字节写入远端并返回可公开访问的链接
+type Uploader interface {
+	Upload(ctx context.Context, path string, data []byte, commitMsg string) (publicURL string, err error)
+}
+
+// NewUploader 根据 storage_backend 配置选择具体的 Uploader 实现
+func NewUploader(cfg Config) (Uploader, error) {
+	switch cfg.StorageBackend {
+	case "", "github":
+		return &GitHubUploader{
+			RepoURL: cfg.GitHubRepoURL,
+			Token:   cfg.GitHubToken,
+			Branch:  cfg.Branch,
+		}, nil
+	case "gitee":
+		return &GiteeUploader{
+			RepoURL: cfg.GiteeRepoURL,
+			Token:   cfg.GiteeToken,
+			Branch:  cfg.Branch,
+		}, nil
+	default:
+		return nil, fmt.Errorf("不支持的存储后端: %s", cfg.StorageBackend)
+	}
+}
+
+// resolveBranchCached 返回 configured（非空时直接用），否则调用 fetch 查询仓库默认分支。
+// 只有查询成功才写入 cached，一次性的网络错误/限流不会被永久缓存，下次调用会重新查询。
+func resolveBranchCached(ctx context.Context, configured string, mu *sync.Mutex, cached *string, fetch func(context.Context) (string, error)) (string, error) {
+	if configured != "" {
+		return configured, nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if *cached != "" {
+		return *cached, nil
+	}
+
+	branch, err := fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	*cached = branch
+	return branch, nil
+}
+
+// --- GitHub 后端 ---
+
+// GitHubUploader 通过 GitHub Contents API 上传/更新文件
+type GitHubUploader struct {
+	RepoURL string // "owner/repo" 格式
+	Token   string
+	Branch  string // 为空时使用仓库默认分支
+
+	branchMu       sync.Mutex
+	resolvedBranch string // 仅在查询成功时缓存，避免把一次性错误永久缓存
+}
+
+func (u *GitHubUploader) Upload(ctx context.Context, path string, data []byte, commitMsg string) (string, error) {
+	branch, err := u.resolveBranch(ctx)
+	if err != nil {
+		return "", fmt.Errorf("解析 GitHub 默认分支失败: %w", err)
+	}
+
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/contents/%s", u.RepoURL, path)
+
+	sha, err := u.fetchExistingSha(ctx, apiURL)
+	if err != nil {
+		return "", fmt.Errorf("查询 GitHub 现有文件失败: %w", err)
+	}
+
+	requestBody := GitHubContentRequest{
+		Message: commitMsg,
+		Content: base64.StdEncoding.EncodeToString(data),
+		Sha:     sha,
+		Branch:  branch,
+	}
+
+	reqBodyBytes, _ := json.Marshal(requestBody)
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", apiURL, bytes.NewBuffer(reqBodyBytes))
+	if err != nil {
+		return "", fmt.Errorf("创建 HTTP 请求失败: %w", err)
+	}
+	req.Header.Set("Authorization", "token "+u.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("发送 GitHub PUT 请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return u.publicURL(path, branch), nil
+}
+
+// resolveBranch 返回实际写入/读取所用的分支: 配置中指定的分支，或仓库的默认分支
+func (u *GitHubUploader) resolveBranch(ctx context.Context) (string, error) {
+	return resolveBranchCached(ctx, u.Branch, &u.branchMu, &u.resolvedBranch, func(ctx context.Context) (string, error) {
+		return fetchGitHubDefaultBranch(ctx, u.RepoURL, u.Token)
+	})
+}
+
+// fetchGitHubDefaultBranch 查询仓库的 default_branch，供未显式配置 branch 时使用
+func fetchGitHubDefaultBranch(ctx context.Context, repoURL, token string) (string, error) {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s", repoURL)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var repoInfo struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&repoInfo); err != nil {
+		return "", err
+	}
+	return repoInfo.DefaultBranch, nil
+}
+
+// fetchExistingSha 查询文件是否已存在，存在则返回其 sha 以便更新；不存在返回空字符串
+func (u *GitHubUploader) fetchExistingSha(ctx context.Context, apiURL string) (string, error) {
+	getURL := apiURL
+	if u.Branch != "" {
+		getURL += "?ref=" + url.QueryEscape(u.Branch)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", getURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "token "+u.Token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode >= 400 {
+		// 其余错误不阻塞上传流程，按"文件不存在"处理，交由后续 PUT 请求报告真实错误
+		return "", nil
+	}
+
+	var existing struct {
+		Sha string `json:"sha"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&existing); err != nil {
+		return "", err
+	}
+	return existing.Sha, nil
+}
+
+func (u *GitHubUploader) publicURL(path, branch string) string {
+	return fmt.Sprintf("https://cdn.staticaly.com/gh/%s/%s/%s", u.RepoURL, branch, path)
+}
+
+// --- Gitee 后端 ---
+
+// GiteeUploader 通过 Gitee v5 Contents API 上传/更新文件
+type GiteeUploader struct {
+	RepoURL string // "owner/repo" 格式
+	Token   string
+	Branch  string // 为空时使用仓库默认分支
+
+	branchMu       sync.Mutex
+	resolvedBranch string // 仅在查询成功时缓存，避免把一次性错误永久缓存
+}
+
+func (u *GiteeUploader) Upload(ctx context.Context, path string, data []byte, commitMsg string) (string, error) {
+	owner, repo, err := splitRepoURL(u.RepoURL)
+	if err != nil {
+		return "", err
+	}
+
+	branch, err := u.resolveBranch(ctx, owner, repo)
+	if err != nil {
+		return "", fmt.Errorf("解析 Gitee 默认分支失败: %w", err)
+	}
+
+	apiURL := fmt.Sprintf("https://gitee.com/api/v5/repos/%s/%s/contents/%s", owner, repo, path)
+
+	sha, err := u.fetchExistingSha(ctx, apiURL)
+	if err != nil {
+		return "", fmt.Errorf("查询 Gitee 现有文件失败: %w", err)
+	}
+
+	form := url.Values{}
+	form.Set("access_token", u.Token)
+	form.Set("content", base64.StdEncoding.EncodeToString(data))
+	form.Set("message", commitMsg)
+	form.Set("branch", branch)
+
+	method := "POST"
+	if sha != "" {
+		form.Set("sha", sha)
+		method = "PUT"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("创建 HTTP 请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("发送 Gitee 请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return u.publicURL(owner, repo, path, branch), nil
+}
+
+// resolveBranch 返回实际写入所用的分支: 配置中指定的分支，或仓库的默认分支
+func (u *GiteeUploader) resolveBranch(ctx context.Context, owner, repo string) (string, error) {
+	return resolveBranchCached(ctx, u.Branch, &u.branchMu, &u.resolvedBranch, func(ctx context.Context) (string, error) {
+		return fetchGiteeDefaultBranch(ctx, owner, repo, u.Token)
+	})
+}
+
+// fetchGiteeDefaultBranch 查询仓库的 default_branch，供未显式配置 branch 时使用
+func fetchGiteeDefaultBranch(ctx context.Context, owner, repo, token string) (string, error) {
+	apiURL := fmt.Sprintf("https://gitee.com/api/v5/repos/%s/%s?access_token=%s", owner, repo, url.QueryEscape(token))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var repoInfo struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&repoInfo); err != nil {
+		return "", err
+	}
+	return repoInfo.DefaultBranch, nil
+}
+
+// fetchExistingSha 查询文件是否已存在，存在则返回其 sha 以便更新；不存在返回空字符串
+func (u *GiteeUploader) fetchExistingSha(ctx context.Context, apiURL string) (string, error) {
+	getURL := apiURL + "?access_token=" + url.QueryEscape(u.Token)
+	if u.Branch != "" {
+		getURL += "&ref=" + url.QueryEscape(u.Branch)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", getURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode >= 400 {
+		return "", nil
+	}
+
+	var existing struct {
+		Sha string `json:"sha"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&existing); err != nil {
+		return "", err
+	}
+	return existing.Sha, nil
+}
+
+func (u *GiteeUploader) publicURL(owner, repo, path, branch string) string {
+	return fmt.Sprintf("https://gitee.com/%s/%s/raw/%s/%s", owner, repo, branch, path)
+}
+
+// splitRepoURL 将 "owner/repo" 格式的字符串拆分为 owner 和 repo
+func splitRepoURL(repoURL string) (owner, repo string, err error) {
+	parts := strings.SplitN(repoURL, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("仓库地址格式错误，期望 \"owner/repo\": %s", repoURL)
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+const typoraLockFileName = "photoclassifier-typora.lock"
+
+// runTyporaUpload 实现 Typora「自定义命令」图床的调用约定：
+// 依次对每个文件路径执行 分类 + 上传，最后按 "Upload Success:" + 每行一个 URL 的格式输出到 stdout。
+// Typora 要求串行调用（并发调用会相互踩踏），因此这里用临时目录下的文件锁防止并发实例互相干扰。
+func runTyporaUpload(cfg Config, paths []string) {
+	unlock, err := acquireTyporaLock()
+	if err != nil {
+		log.Fatalf("获取上传锁失败: %v", err)
+	}
+	defer unlock()
+
+	classifier, err := NewVisionClassifier(cfg)
+	if err != nil {
+		log.Fatalf("初始化视觉模型失败: %v", err)
+	}
+
+	uploader, err := NewUploader(cfg)
+	if err != nil {
+		log.Fatalf("初始化存储后端失败: %v", err)
+	}
+
+	prompt := fmt.Sprintf(`请根据图片内容，从以下分类列表中选出最相关的标签，仅以 {"cate":["标签"]} 的 JSON 格式返回: %s`, cfg.TargetClasses)
+
+	ctx := context.Background()
+	urls := make([]string, 0, len(paths))
+
+	for _, path := range paths {
+		imgData, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatalf("无法读取文件 %s: %v", path, err)
+		}
+
+		categories, _, err := classifier.Classify(ctx, imgData, prompt)
+		if err != nil {
+			log.Fatalf("分类图片 %s 失败: %v", path, err)
+		}
+		if len(categories) == 0 {
+			log.Fatalf("分类图片 %s 未返回有效分类标签", path)
+		}
+		cat := categories[0]
+		safeCat := sanitizeCategory(cat)
+
+		uploadData, uploadExt, err := compressImage(imgData, cfg.Compress)
+		if err != nil {
+			uploadData, uploadExt = imgData, DetectImageFormat(imgData)
+		}
+
+		fname := strconv.Itoa(classMap[cat]) + "." + uploadExt
+		uploadPath := filepath.Join(cfg.GitHubDir, safeCat, fname)
+		commitMsg := fmt.Sprintf("[PhotoClassifier] Classify and upload %s to category %s", filepath.Base(path), cat)
+
+		publicURL, err := uploader.Upload(ctx, uploadPath, uploadData, commitMsg)
+		if err != nil {
+			log.Fatalf("上传图片 %s 失败: %v", path, err)
+		}
+		classMap[cat]++
+		urls = append(urls, publicURL)
+	}
+
+	// 每个进程独立加载 class_idx，必须把递增后的结果落盘，
+	// 否则连续两次 Typora 调用会从同一个起始索引出发，覆盖彼此的上传结果
+	if err := persistClassMap(cfg); err != nil {
+		log.Printf("保存分类索引失败: %v", err)
+	}
+
+	fmt.Println("Upload Success:")
+	for _, u := range urls {
+		fmt.Println(u)
+	}
+}
+
+// acquireTyporaLock 在系统临时目录下获取文件锁，避免 Typora 并发调用互相踩踏
+func acquireTyporaLock() (unlock func(), err error) {
+	lockPath := filepath.Join(os.TempDir(), typoraLockFileName)
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("打开锁文件失败: %w", err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("加锁失败: %w", err)
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
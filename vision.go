@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"google.golang.org/genai"
+)
+
+// VisionClassifier 抽象图片分类模型，屏蔽 Gemini / OpenAI 兼容接口之间的差异
+type VisionClassifier interface {
+	Classify(ctx context.Context, imgBytes []byte, prompt string) (categories []string, tokens int, err error)
+}
+
+// NewVisionClassifier 根据 llm_type 配置选择具体的 VisionClassifier 实现
+func NewVisionClassifier(cfg Config) (VisionClassifier, error) {
+	switch cfg.LLMType {
+	case "gemini":
+		return &GeminiClassifier{cfg: cfg}, nil
+	case "openai":
+		return &OpenAIClassifier{cfg: cfg}, nil
+	default:
+		return nil, fmt.Errorf("不支持的 llm_type: %s", cfg.LLMType)
+	}
+}
+
+// --- Gemini 实现 ---
+
+// GeminiClassifier 通过 google.golang.org/genai 调用 Gemini 完成图片分类
+type GeminiClassifier struct {
+	cfg Config
+}
+
+func (c *GeminiClassifier) Classify(ctx context.Context, imgBytes []byte, prompt string) ([]string, int, error) {
+	client, err := GetGeminiClient(ctx)
+	if err != nil {
+		log.Println("create client fail", "err", err)
+		return nil, 0, err
+	}
+
+	parts := []*genai.Part{
+		genai.NewPartFromBytes(imgBytes, "image/"+DetectImageFormat(imgBytes)),
+		genai.NewPartFromText(prompt),
+	}
+
+	contents := []*genai.Content{
+		genai.NewContentFromParts(parts, genai.RoleUser),
+	}
+
+	result, err := client.Models.GenerateContent(
+		ctx,
+		c.cfg.ModelName,
+		contents,
+		nil,
+	)
+
+	if err != nil || result == nil {
+		log.Println("generate text fail", "err", err)
+		return nil, 0, mapGenaiError(err)
+	}
+
+	if result.Text() != "" {
+		categories := extractCategories(result.Text())
+		return categories, int(result.UsageMetadata.TotalTokenCount), nil
+	}
+
+	return nil, int(result.UsageMetadata.TotalTokenCount), nil
+}
+
+// mapGenaiError 把 genai SDK 返回的 API 错误转换为 HTTPStatusError，
+// 使 withRetry 能像对待 HTTP 响应一样识别 Gemini 的 429/5xx 错误
+func mapGenaiError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var apiErr *genai.APIError
+	if errors.As(err, &apiErr) {
+		return &HTTPStatusError{StatusCode: apiErr.Code, Body: apiErr.Message}
+	}
+	return err
+}
+
+// --- OpenAI 兼容实现 ---
+
+// OpenAIClassifier 调用任意 OpenAI Chat Completions 兼容接口 (OpenAI、Ollama、vLLM、OpenRouter 等) 完成图片分类
+type OpenAIClassifier struct {
+	cfg Config
+}
+
+type openAIChatRequest struct {
+	Model    string              `json:"model"`
+	Messages []openAIChatMessage `json:"messages"`
+}
+
+type openAIChatMessage struct {
+	Role    string                   `json:"role"`
+	Content []openAIChatContentBlock `json:"content"`
+}
+
+type openAIChatContentBlock struct {
+	Type     string              `json:"type"`
+	Text     string              `json:"text,omitempty"`
+	ImageURL *openAIChatImageURL `json:"image_url,omitempty"`
+}
+
+type openAIChatImageURL struct {
+	URL string `json:"url"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+func (c *OpenAIClassifier) Classify(ctx context.Context, imgBytes []byte, prompt string) ([]string, int, error) {
+	baseURL := c.cfg.ModelCustomURL
+	if baseURL == "" {
+		baseURL = "https://api.openai.com"
+	}
+
+	dataURL := fmt.Sprintf("data:image/%s;base64,%s", DetectImageFormat(imgBytes), base64.StdEncoding.EncodeToString(imgBytes))
+
+	reqBody := openAIChatRequest{
+		Model: c.cfg.ModelName,
+		Messages: []openAIChatMessage{
+			{
+				Role: "user",
+				Content: []openAIChatContentBlock{
+					{Type: "text", Text: prompt},
+					{Type: "image_url", ImageURL: &openAIChatImageURL{URL: dataURL}},
+				},
+			},
+		},
+	}
+
+	reqBodyBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, 0, fmt.Errorf("序列化请求体失败: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/v1/chat/completions", bytes.NewBuffer(reqBodyBytes))
+	if err != nil {
+		return nil, 0, fmt.Errorf("创建 HTTP 请求失败: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.cfg.ModelToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := GetLLMProxyClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("发送请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, 0, &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var chatResp openAIChatResponse
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		return nil, 0, fmt.Errorf("解析响应失败: %w", err)
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return nil, chatResp.Usage.TotalTokens, nil
+	}
+
+	categories := extractCategories(chatResp.Choices[0].Message.Content)
+	return categories, chatResp.Usage.TotalTokens, nil
+}
+
+// extractCategories 从模型输出文本中提取 {"cate":[...]} 结构
+func extractCategories(text string) []string {
+	matches := cateRegex.FindAllString(text, -1)
+	cateRes := new(CateInfo)
+	for _, match := range matches {
+		if err := json.Unmarshal([]byte(match), cateRes); err != nil {
+			log.Println("json umarshal fail", "err", err)
+		}
+	}
+	return cateRes.Cate
+}